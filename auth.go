@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Scopes recognized by the API. Handlers declare the minimum scope a caller
+// must hold; "graph:admin" implicitly satisfies any lower scope check.
+const (
+	scopeRead  = "graph:read"
+	scopeWrite = "graph:write"
+	scopeAdmin = "graph:admin"
+)
+
+// jwtClaims is the payload carried by tokens minted by /auth/token. It is
+// intentionally small: only what the scope middleware needs to decide
+// whether a request is authorized.
+type jwtClaims struct {
+	Subject string   `json:"sub"`
+	Scopes  []string `json:"scopes"`
+	Exp     int64    `json:"exp"`
+	Nbf     int64    `json:"nbf"`
+}
+
+func (c jwtClaims) hasScope(required string) bool {
+	for _, s := range c.Scopes {
+		if s == required || s == scopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticator signs and verifies tokens using whichever key material is
+// configured via environment variables: HS256 (AUTH_JWT_SECRET) or Ed25519
+// (AUTH_JWT_PRIVKEY/AUTH_JWT_PUBKEY, base64-encoded raw keys).
+type authenticator struct {
+	hmacSecret []byte
+
+	ed25519Priv ed25519.PrivateKey
+	ed25519Pub  ed25519.PublicKey
+
+	adminKey string
+}
+
+func newAuthenticatorFromEnv() (*authenticator, error) {
+	a := &authenticator{adminKey: os.Getenv("AUTH_ADMIN_KEY")}
+
+	if secret := os.Getenv("AUTH_JWT_SECRET"); secret != "" {
+		a.hmacSecret = []byte(secret)
+		return a, nil
+	}
+
+	if pub := os.Getenv("AUTH_JWT_PUBKEY"); pub != "" {
+		pubBytes, err := base64.StdEncoding.DecodeString(pub)
+		if err != nil {
+			return nil, fmt.Errorf("auth: decoding AUTH_JWT_PUBKEY: %w", err)
+		}
+		a.ed25519Pub = ed25519.PublicKey(pubBytes)
+
+		if priv := os.Getenv("AUTH_JWT_PRIVKEY"); priv != "" {
+			privBytes, err := base64.StdEncoding.DecodeString(priv)
+			if err != nil {
+				return nil, fmt.Errorf("auth: decoding AUTH_JWT_PRIVKEY: %w", err)
+			}
+			a.ed25519Priv = ed25519.PrivateKey(privBytes)
+		}
+		return a, nil
+	}
+
+	return nil, fmt.Errorf("auth: neither AUTH_JWT_SECRET nor AUTH_JWT_PUBKEY is set")
+}
+
+func b64url(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (a *authenticator) alg() string {
+	if a.hmacSecret != nil {
+		return "HS256"
+	}
+	return "EdDSA"
+}
+
+// sign mints a compact JWT (header.payload.signature, base64url, unpadded).
+func (a *authenticator) sign(claims jwtClaims) (string, error) {
+	header := map[string]string{"alg": a.alg(), "typ": "JWT"}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := b64url(headerJSON) + "." + b64url(claimsJSON)
+
+	var sig []byte
+	switch {
+	case a.hmacSecret != nil:
+		mac := hmac.New(sha256.New, a.hmacSecret)
+		mac.Write([]byte(signingInput))
+		sig = mac.Sum(nil)
+	case a.ed25519Priv != nil:
+		sig = ed25519.Sign(a.ed25519Priv, []byte(signingInput))
+	default:
+		return "", fmt.Errorf("auth: no private key material configured for signing")
+	}
+	return signingInput + "." + b64url(sig), nil
+}
+
+// verify checks the signature and exp/nbf bounds, returning the decoded
+// claims on success.
+func (a *authenticator) verify(token string) (jwtClaims, error) {
+	var claims jwtClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, fmt.Errorf("auth: malformed token")
+	}
+	signingInput := parts[0] + "." + parts[1]
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("auth: malformed signature: %w", err)
+	}
+
+	switch {
+	case a.hmacSecret != nil:
+		mac := hmac.New(sha256.New, a.hmacSecret)
+		mac.Write([]byte(signingInput))
+		expected := mac.Sum(nil)
+		if subtle.ConstantTimeCompare(expected, sig) != 1 {
+			return claims, fmt.Errorf("auth: invalid signature")
+		}
+	case a.ed25519Pub != nil:
+		if !ed25519.Verify(a.ed25519Pub, []byte(signingInput), sig) {
+			return claims, fmt.Errorf("auth: invalid signature")
+		}
+	default:
+		return claims, fmt.Errorf("auth: no public key material configured for verification")
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, fmt.Errorf("auth: malformed claims: %w", err)
+	}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return claims, fmt.Errorf("auth: invalid claims: %w", err)
+	}
+
+	now := time.Now().Unix()
+	if claims.Exp != 0 && now >= claims.Exp {
+		return claims, fmt.Errorf("auth: token expired")
+	}
+	if claims.Nbf != 0 && now < claims.Nbf {
+		return claims, fmt.Errorf("auth: token not yet valid")
+	}
+	return claims, nil
+}
+
+// requireScope returns middleware that validates the bearer token and
+// rejects requests that don't carry the required scope.
+func (a *authenticator) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authz := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authz, "Bearer ") {
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+		claims, err := a.verify(strings.TrimPrefix(authz, "Bearer "))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !claims.hasScope(scope) {
+			http.Error(w, fmt.Sprintf("token lacks required scope %q", scope), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// handleMintToken issues a short-lived token for a configured admin key.
+// POST /auth/token {"admin_key":"...", "scopes":["graph:write"], "ttl_seconds":300}
+func (a *authenticator) handleMintToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.adminKey == "" {
+		http.Error(w, "auth: token minting is not configured (AUTH_ADMIN_KEY unset)", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		AdminKey   string   `json:"admin_key"`
+		Subject    string   `json:"subject"`
+		Scopes     []string `json:"scopes"`
+		TTLSeconds int64    `json:"ttl_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.AdminKey), []byte(a.adminKey)) != 1 {
+		http.Error(w, "invalid admin key", http.StatusUnauthorized)
+		return
+	}
+	if req.TTLSeconds <= 0 || req.TTLSeconds > 3600 {
+		req.TTLSeconds = 300
+	}
+
+	now := time.Now()
+	claims := jwtClaims{
+		Subject: req.Subject,
+		Scopes:  req.Scopes,
+		Nbf:     now.Unix(),
+		Exp:     now.Add(time.Duration(req.TTLSeconds) * time.Second).Unix(),
+	}
+	token, err := a.sign(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"token":      token,
+		"expires_at": claims.Exp,
+	})
+}
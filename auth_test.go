@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestAuthenticator(t *testing.T) *authenticator {
+	t.Helper()
+	return &authenticator{hmacSecret: []byte("test-secret")}
+}
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	a := newTestAuthenticator(t)
+	now := time.Now()
+	claims := jwtClaims{Subject: "svc", Scopes: []string{scopeWrite}, Nbf: now.Unix(), Exp: now.Add(time.Minute).Unix()}
+	token, err := a.sign(claims)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	got, err := a.verify(token)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if got.Subject != "svc" || !got.hasScope(scopeWrite) {
+		t.Errorf("unexpected claims: %+v", got)
+	}
+}
+
+func TestVerifyRejectsExpiredToken(t *testing.T) {
+	a := newTestAuthenticator(t)
+	token, err := a.sign(jwtClaims{Subject: "svc", Exp: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := a.verify(token); err == nil {
+		t.Error("expected expired token to be rejected")
+	}
+}
+
+func TestVerifyRejectsTamperedSignature(t *testing.T) {
+	a := newTestAuthenticator(t)
+	token, err := a.sign(jwtClaims{Subject: "svc", Exp: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	tampered := token[:len(token)-1] + "x"
+	if _, err := a.verify(tampered); err == nil {
+		t.Error("expected tampered signature to be rejected")
+	}
+}
+
+func TestRequireScopeRejectsMissingOrInsufficientScope(t *testing.T) {
+	a := newTestAuthenticator(t)
+	var handlerCalled bool
+	h := a.requireScope(scopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+		handlerCalled = true
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/clear", nil)
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("missing bearer token: expected 401, got %d", rec.Code)
+	}
+
+	readToken, _ := a.sign(jwtClaims{Scopes: []string{scopeRead}, Exp: time.Now().Add(time.Minute).Unix()})
+	req = httptest.NewRequest(http.MethodGet, "/clear", nil)
+	req.Header.Set("Authorization", "Bearer "+readToken)
+	rec = httptest.NewRecorder()
+	h(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("insufficient scope: expected 403, got %d", rec.Code)
+	}
+	if handlerCalled {
+		t.Error("handler ran without holding the required scope")
+	}
+
+	adminToken, _ := a.sign(jwtClaims{Scopes: []string{scopeAdmin}, Exp: time.Now().Add(time.Minute).Unix()})
+	req = httptest.NewRequest(http.MethodGet, "/clear", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rec = httptest.NewRecorder()
+	h(rec, req)
+	if !handlerCalled {
+		t.Error("handler did not run despite holding the required scope")
+	}
+}
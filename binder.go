@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Binder decodes a request body (or, for GET/DELETE, query parameters) into
+// dst based on the request's Content-Type. Handlers depend on the interface
+// rather than a concrete decoder so new formats are a one-line registration
+// away; see defaultBinder.decoders.
+type Binder interface {
+	Bind(r *http.Request, dst interface{}) error
+}
+
+type decodeFunc func(r *http.Request, dst interface{}) error
+
+// defaultBinder is the Binder used by the server. JSON is the fallback when
+// Content-Type is absent, matching the previous hard-coded behavior.
+type defaultBinder struct {
+	decoders map[string]decodeFunc
+}
+
+func newDefaultBinder() *defaultBinder {
+	b := &defaultBinder{decoders: make(map[string]decodeFunc)}
+	b.Register("application/json", decodeJSON)
+	b.Register("application/xml", decodeXML)
+	b.Register("text/xml", decodeXML)
+	b.Register("application/x-www-form-urlencoded", decodeForm)
+	b.Register("application/x-protobuf", decodeProtobuf)
+	b.Register("application/protobuf", decodeProtobuf)
+	return b
+}
+
+// Register adds (or replaces) the decoder used for a Content-Type.
+func (b *defaultBinder) Register(contentType string, fn decodeFunc) {
+	b.decoders[contentType] = fn
+}
+
+func (b *defaultBinder) Bind(r *http.Request, dst interface{}) error {
+	if r.Method == http.MethodGet || r.Method == http.MethodDelete {
+		return bindQuery(r, dst)
+	}
+
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		ct = "application/json"
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		mediaType = ct
+	}
+	dec, ok := b.decoders[mediaType]
+	if !ok {
+		return fmt.Errorf("binder: unsupported Content-Type %q", mediaType)
+	}
+	return dec(r, dst)
+}
+
+func decodeJSON(r *http.Request, dst interface{}) error {
+	return json.NewDecoder(r.Body).Decode(dst)
+}
+
+func decodeXML(r *http.Request, dst interface{}) error {
+	return xml.NewDecoder(r.Body).Decode(dst)
+}
+
+func decodeForm(r *http.Request, dst interface{}) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	return bindValues(r.PostForm, dst, "form")
+}
+
+// bindQuery fills dst's `query:"..."` tagged fields from the request's URL
+// query parameters. Used for GET/DELETE, which have no body to decode.
+func bindQuery(r *http.Request, dst interface{}) error {
+	return bindValues(r.URL.Query(), dst, "query")
+}
+
+// bindValues reflects over dst (a pointer to struct) and sets each field
+// tagged `<tag>:"name"` from values[name], doing a best-effort string ->
+// field-type conversion for the handful of kinds handlers actually use.
+func bindValues(values map[string][]string, dst interface{}, tag string) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("binder: dst must be a pointer to struct")
+	}
+	elem := v.Elem()
+	t := elem.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get(tag)
+		if name == "" {
+			continue
+		}
+		raw, ok := values[name]
+		if !ok || len(raw) == 0 {
+			continue
+		}
+		fv := elem.Field(i)
+		if err := setFieldFromString(fv, raw[0]); err != nil {
+			return fmt.Errorf("binder: field %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setFieldFromString(fv reflect.Value, s string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field kind %s", fv.Kind())
+	}
+	return nil
+}
+
+// decodeProtobuf is a minimal protobuf wire-format reader: it understands
+// length-delimited (wire type 2) fields only, and binds them to string
+// fields tagged `protobuf:"<field number>"`. It intentionally does not
+// support the full set of protobuf types — callers needing those should
+// generate real protoc-gen-go bindings and decode ahead of the binder.
+func decodeProtobuf(r *http.Request, dst interface{}) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	fields := make(map[int][]byte)
+	for i := 0; i < len(body); {
+		tag, n := protobufUvarint(body[i:])
+		if n == 0 {
+			return fmt.Errorf("binder: malformed protobuf tag")
+		}
+		i += n
+		fieldNum := int(tag >> 3)
+		wireType := tag & 0x7
+		if wireType != 2 {
+			return fmt.Errorf("binder: unsupported protobuf wire type %d", wireType)
+		}
+		length, n := protobufUvarint(body[i:])
+		if n == 0 {
+			return fmt.Errorf("binder: malformed protobuf length")
+		}
+		i += n
+		if i+int(length) > len(body) {
+			return fmt.Errorf("binder: protobuf field length out of range")
+		}
+		fields[fieldNum] = body[i : i+int(length)]
+		i += int(length)
+	}
+
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("binder: dst must be a pointer to struct")
+	}
+	elem := v.Elem()
+	t := elem.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tagVal := t.Field(i).Tag.Get("protobuf")
+		if tagVal == "" {
+			continue
+		}
+		num, err := strconv.Atoi(tagVal)
+		if err != nil {
+			continue
+		}
+		if raw, ok := fields[num]; ok && elem.Field(i).Kind() == reflect.String {
+			elem.Field(i).SetString(string(raw))
+		}
+	}
+	return nil
+}
+
+func protobufUvarint(b []byte) (uint64, int) {
+	var x uint64
+	var s uint
+	for i, c := range b {
+		if c < 0x80 {
+			return x | uint64(c)<<s, i + 1
+		}
+		x |= uint64(c&0x7f) << s
+		s += 7
+	}
+	return 0, 0
+}
+
+// Renderer writes v to w in whatever format the client's Accept header
+// prefers, defaulting to JSON.
+type Renderer interface {
+	Render(w http.ResponseWriter, r *http.Request, status int, v interface{}) error
+}
+
+type encodeFunc func(w http.ResponseWriter, v interface{}) error
+
+type defaultRenderer struct {
+	encoders map[string]encodeFunc
+}
+
+func newDefaultRenderer() *defaultRenderer {
+	ren := &defaultRenderer{encoders: make(map[string]encodeFunc)}
+	ren.Register("application/json", renderJSON)
+	ren.Register("application/xml", renderXML)
+	ren.Register("application/x-ndjson", renderNDJSON)
+	return ren
+}
+
+// Register adds (or replaces) the encoder used for a media type, so adding a
+// new output format is a one-line call rather than a renderer rewrite.
+func (ren *defaultRenderer) Register(mediaType string, fn encodeFunc) {
+	ren.encoders[mediaType] = fn
+}
+
+func (ren *defaultRenderer) Render(w http.ResponseWriter, r *http.Request, status int, v interface{}) error {
+	mediaType := ren.negotiate(r.Header.Get("Accept"))
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+	return ren.encoders[mediaType](w, v)
+}
+
+// negotiate picks the first registered encoder the client's Accept header
+// allows, falling back to JSON when nothing matches (including "*/*" or an
+// empty header).
+func (ren *defaultRenderer) negotiate(accept string) string {
+	if accept == "" {
+		return "application/json"
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mt := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if mt == "*/*" {
+			return "application/json"
+		}
+		if _, ok := ren.encoders[mt]; ok {
+			return mt
+		}
+	}
+	return "application/json"
+}
+
+func renderJSON(w http.ResponseWriter, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func renderXML(w http.ResponseWriter, v interface{}) error {
+	return xml.NewEncoder(w).Encode(v)
+}
+
+// renderNDJSON writes each element of a slice as its own JSON line. Any other
+// value is written as a single JSON line; /export renders a snapshot map, so
+// its NDJSON output is one line holding the whole graph.
+func renderNDJSON(w http.ResponseWriter, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return json.NewEncoder(w).Encode(v)
+	}
+	enc := json.NewEncoder(w)
+	for i := 0; i < rv.Len(); i++ {
+		if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stagingBuffer accumulates a resumable import's chunks until the client
+// issues the final commit PUT. It is deliberately simple: an in-memory
+// byte buffer per upload, reclaimed by a GC goroutine if the client
+// disappears mid-upload.
+type stagingBuffer struct {
+	mu           sync.Mutex
+	id           string
+	data         []byte
+	lastActivity time.Time
+}
+
+// importManager tracks in-flight resumable uploads, modeled on registry
+// blob-upload semantics: POST creates an upload, PATCH appends chunks and
+// reports progress via a Range header, PUT commits (or aborts on digest
+// mismatch).
+type importManager struct {
+	mu      sync.Mutex
+	uploads map[string]*stagingBuffer
+	gs      *GraphStore
+	idleTTL time.Duration
+}
+
+func newImportManager(gs *GraphStore) *importManager {
+	im := &importManager{
+		uploads: make(map[string]*stagingBuffer),
+		gs:      gs,
+		idleTTL: 30 * time.Minute,
+	}
+	go im.gcLoop()
+	return im
+}
+
+func (im *importManager) gcLoop() {
+	ticker := time.NewTicker(5 * time.Minute)
+	for range ticker.C {
+		im.reap()
+	}
+}
+
+func (im *importManager) reap() {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	now := time.Now()
+	for id, buf := range im.uploads {
+		buf.mu.Lock()
+		idle := now.Sub(buf.lastActivity)
+		buf.mu.Unlock()
+		if idle > im.idleTTL {
+			delete(im.uploads, id)
+		}
+	}
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// handleImportStart serves POST /import: it allocates an upload UUID and
+// tells the client where to PATCH chunks.
+func (im *importManager) handleImportStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := newUploadID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	im.mu.Lock()
+	im.uploads[id] = &stagingBuffer{id: id, lastActivity: time.Now()}
+	im.mu.Unlock()
+
+	w.Header().Set("Location", "/import/"+id)
+	w.Header().Set("Range", "0-0")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleImportChunk serves both PATCH /import/{uuid} (append a chunk) and
+// PUT /import/{uuid}?commit=1 (finalize).
+func (im *importManager) handleImportChunk(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/import/")
+	if id == "" {
+		http.Error(w, "upload id required", http.StatusBadRequest)
+		return
+	}
+	im.mu.Lock()
+	buf, ok := im.uploads[id]
+	im.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown or expired upload", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPatch:
+		im.appendChunk(w, r, buf)
+	case http.MethodPut:
+		if r.URL.Query().Get("commit") != "1" {
+			http.Error(w, "PUT requires ?commit=1", http.StatusBadRequest)
+			return
+		}
+		im.commit(w, r, buf)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (im *importManager) appendChunk(w http.ResponseWriter, r *http.Request, buf *stagingBuffer) {
+	chunk, err := io.ReadAll(io.LimitReader(r.Body, 16*1024*1024))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("import: reading chunk: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	buf.mu.Lock()
+	buf.data = append(buf.data, chunk...)
+	n := len(buf.data)
+	buf.lastActivity = time.Now()
+	buf.mu.Unlock()
+
+	w.Header().Set("Range", fmt.Sprintf("0-%d", n))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// importRecord is one line of the NDJSON body committed at the end of a
+// resumable import.
+type importRecord struct {
+	Type string `json:"type"` // "node" or "edge"
+	Node Node   `json:"node,omitempty"`
+	Edge Edge   `json:"edge,omitempty"`
+}
+
+// commit verifies the SHA-256 digest of the fully-assembled upload, parses
+// it as NDJSON records, and merges the result into the GraphStore as a
+// single batch.
+func (im *importManager) commit(w http.ResponseWriter, r *http.Request, buf *stagingBuffer) {
+	var req struct {
+		Digest string `json:"digest"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("import: invalid commit request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Digest == "" {
+		http.Error(w, "import: digest is required to commit", http.StatusBadRequest)
+		return
+	}
+
+	buf.mu.Lock()
+	data := make([]byte, len(buf.data))
+	copy(data, buf.data)
+	buf.mu.Unlock()
+
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+	if !strings.EqualFold(req.Digest, actual) {
+		writeJSON(w, http.StatusConflict, map[string]string{
+			"error":    "digest mismatch",
+			"expected": req.Digest,
+			"actual":   actual,
+		})
+		return
+	}
+
+	var nodes []Node
+	var edges []Edge
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var rec importRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			http.Error(w, fmt.Sprintf("import: invalid record at line %d: %v", lineNo, err), http.StatusBadRequest)
+			return
+		}
+		switch rec.Type {
+		case "node":
+			nodes = append(nodes, rec.Node)
+		case "edge":
+			edges = append(edges, rec.Edge)
+		default:
+			http.Error(w, fmt.Sprintf("import: unknown record type %q at line %d", rec.Type, lineNo), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := im.gs.validateBatchRefs(nodes, edges); err != nil {
+		http.Error(w, fmt.Sprintf("import: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := im.gs.commitBatch(nodes, edges); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	im.mu.Lock()
+	delete(im.uploads, buf.id)
+	im.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":      "committed",
+		"nodes_added": len(nodes),
+		"edges_added": len(edges),
+		"digest":      actual,
+	})
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ingestLineError reports a single failed line without aborting the rest of
+// the batch (unless ?atomic=true was requested).
+type ingestLineError struct {
+	Line int    `json:"line"`
+	Msg  string `json:"msg"`
+}
+
+type ingestSummary struct {
+	NodesAdded int               `json:"nodes_added"`
+	EdgesAdded int               `json:"edges_added"`
+	Errors     []ingestLineError `json:"errors"`
+}
+
+type ingestOpKind int
+
+const (
+	ingestOpNode ingestOpKind = iota
+	ingestOpEdge
+)
+
+type ingestOp struct {
+	line int
+	kind ingestOpKind
+	node Node
+	edge Edge
+}
+
+// parseLineProtocol tokenizes a single line of the InfluxDB-style line
+// protocol subset this endpoint accepts:
+//
+//	node,id=abc key1=val1,key2=val2
+//	edge,from=abc,to=def label="knows"
+func parseLineProtocol(lineNo int, line string) (ingestOp, error) {
+	var op ingestOp
+	op.line = lineNo
+
+	parts := strings.SplitN(line, " ", 2)
+	tagSet := strings.Split(parts[0], ",")
+	measurement := tagSet[0]
+	tags := make(map[string]string, len(tagSet)-1)
+	for _, kv := range tagSet[1:] {
+		k, v, err := splitKV(kv)
+		if err != nil {
+			return op, err
+		}
+		tags[k] = v
+	}
+
+	var fields map[string]string
+	if len(parts) == 2 {
+		fields = make(map[string]string)
+		for _, kv := range splitFields(parts[1]) {
+			k, v, err := splitKV(kv)
+			if err != nil {
+				return op, err
+			}
+			fields[k] = unquote(v)
+		}
+	}
+
+	switch measurement {
+	case "node":
+		id, ok := tags["id"]
+		if !ok || id == "" {
+			return op, fmt.Errorf("node record missing id tag")
+		}
+		op.kind = ingestOpNode
+		op.node = Node{ID: id, Props: fields}
+	case "edge":
+		from, okFrom := tags["from"]
+		to, okTo := tags["to"]
+		if !okFrom || !okTo || from == "" || to == "" {
+			return op, fmt.Errorf("edge record requires from and to tags")
+		}
+		op.kind = ingestOpEdge
+		op.edge = Edge{From: from, To: to, Label: fields["label"]}
+	default:
+		return op, fmt.Errorf("unknown record kind %q (expected node or edge)", measurement)
+	}
+	return op, nil
+}
+
+func splitKV(s string) (string, string, error) {
+	eq := strings.IndexByte(s, '=')
+	if eq < 0 {
+		return "", "", fmt.Errorf("expected key=value, got %q", s)
+	}
+	return s[:eq], s[eq+1:], nil
+}
+
+// splitFields splits a field-set on commas that are not inside a quoted
+// string, so `label="a,b"` stays one field.
+func splitFields(s string) []string {
+	var out []string
+	var cur strings.Builder
+	inQuotes := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			cur.WriteRune(r)
+		case r == ',' && !inQuotes:
+			out = append(out, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		out = append(out, cur.String())
+	}
+	return out
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// runIngest validates a parsed batch against the current graph state (plus
+// any nodes the batch itself adds) under a single lock acquisition, then
+// returns the accepted nodes/edges to commit along with any per-line errors.
+// In atomic mode a single error discards the whole batch.
+func (gs *GraphStore) runIngest(ops []ingestOp, atomic bool) (acceptedNodes []Node, acceptedEdges []Edge, errs []ingestLineError) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	known := make(map[string]bool, len(gs.nodes))
+	for id := range gs.nodes {
+		known[id] = true
+	}
+
+	for _, op := range ops {
+		switch op.kind {
+		case ingestOpNode:
+			known[op.node.ID] = true
+			acceptedNodes = append(acceptedNodes, op.node)
+		case ingestOpEdge:
+			if !known[op.edge.From] {
+				errs = append(errs, ingestLineError{Line: op.line, Msg: fmt.Sprintf("source node %s does not exist", op.edge.From)})
+				if atomic {
+					return nil, nil, errs
+				}
+				continue
+			}
+			if !known[op.edge.To] {
+				errs = append(errs, ingestLineError{Line: op.line, Msg: fmt.Sprintf("target node %s does not exist", op.edge.To)})
+				if atomic {
+					return nil, nil, errs
+				}
+				continue
+			}
+			acceptedEdges = append(acceptedEdges, op.edge)
+		}
+	}
+
+	if atomic && len(errs) > 0 {
+		return nil, nil, errs
+	}
+	return acceptedNodes, acceptedEdges, errs
+}
+
+// commitBatch replicates the accepted batch through raft when enabled, or
+// applies it directly otherwise.
+func (gs *GraphStore) commitBatch(nodes []Node, edges []Edge) error {
+	if len(nodes) == 0 && len(edges) == 0 {
+		return nil
+	}
+	if gs.raft != nil {
+		return gs.raft.Propose(entryBatch, batchMutation{Nodes: nodes, Edges: edges})
+	}
+	gs.applyBatch(nodes, edges)
+	return nil
+}
+
+// handleIngest serves POST /ingest, reading the body as a stream of line
+// protocol records rather than buffering it whole, so multi-MB payloads
+// don't need to fit in memory twice.
+func (gs *GraphStore) handleIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	atomic := r.URL.Query().Get("atomic") == "true"
+
+	var ops []ingestOp
+	var errs []ingestLineError
+
+	// The scanner runs on its own goroutine so the handler can race line
+	// arrival against both an idle read deadline and the request's own
+	// context (e.g. from X-Request-Timeout), rolling back (committing
+	// nothing) if either fires before the body is fully read. done lets the
+	// scanner goroutine unblock and exit on every early-return path below
+	// instead of leaking parked on an unbuffered send nobody will read again.
+	done := make(chan struct{})
+	defer close(done)
+
+	lines := make(chan string)
+	scanErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-done:
+				return
+			}
+		}
+		select {
+		case scanErr <- scanner.Err():
+		case <-done:
+		}
+	}()
+
+	idle := newDeadlineTimer(30 * time.Second)
+	defer idle.Stop()
+
+	lineNo := 0
+readLoop:
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				break readLoop
+			}
+			idle.Reset(30 * time.Second)
+			lineNo++
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" {
+				continue
+			}
+			op, err := parseLineProtocol(lineNo, trimmed)
+			if err != nil {
+				errs = append(errs, ingestLineError{Line: lineNo, Msg: err.Error()})
+				if atomic {
+					writeJSON(w, http.StatusBadRequest, ingestSummary{Errors: errs})
+					return
+				}
+				continue
+			}
+			ops = append(ops, op)
+		case <-idle.Done():
+			http.Error(w, "ingest: no data received within the read deadline", http.StatusGatewayTimeout)
+			return
+		case <-r.Context().Done():
+			http.Error(w, "ingest: request exceeded its deadline", http.StatusGatewayTimeout)
+			return
+		}
+	}
+	if err := <-scanErr; err != nil {
+		http.Error(w, fmt.Sprintf("ingest: reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	nodes, edges, validationErrs := gs.runIngest(ops, atomic)
+	errs = append(errs, validationErrs...)
+
+	if atomic && len(validationErrs) > 0 {
+		writeJSON(w, http.StatusBadRequest, ingestSummary{Errors: errs})
+		return
+	}
+
+	if err := gs.commitBatch(nodes, edges); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	summary := ingestSummary{NodesAdded: len(nodes), EdgesAdded: len(edges), Errors: errs}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
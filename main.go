@@ -13,6 +13,13 @@ import (
 	"time"
 )
 
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
 type Node struct {
 	ID    string            `json:"id"`
 	Props map[string]string `json:"props,omitempty"`
@@ -28,44 +35,162 @@ type GraphStore struct {
 	nodes map[string]Node
 	edges []Edge
 	mu    sync.RWMutex
+
+	// outByFrom/inByTo index edges by endpoint so traversal (e.g. query
+	// execution) is O(degree) instead of O(|E|). Kept in sync by
+	// applyAddEdge/applyClear/rebuildIndexes.
+	outByFrom map[string][]int
+	inByTo    map[string][]int
+
+	// raft replicates every mutation through a leader before it is applied
+	// locally. It is nil when the store is running standalone (e.g. in
+	// tests), in which case mutations apply directly.
+	raft *raftNode
+
+	binder   Binder
+	renderer Renderer
+
+	// traffic observes request counts/latency and tracing spans. Nil means
+	// no observation is configured, in which case trafficMiddleware and
+	// startSpan are no-ops.
+	traffic TrafficController
 }
 
 func NewGraphStore() *GraphStore {
 	return &GraphStore{
-		nodes: make(map[string]Node),
-		edges: make([]Edge, 0),
+		nodes:     make(map[string]Node),
+		edges:     make([]Edge, 0),
+		outByFrom: make(map[string][]int),
+		inByTo:    make(map[string][]int),
+		binder:    newDefaultBinder(),
+		renderer:  newDefaultRenderer(),
 	}
 }
 
+// AddNode validates and proposes a node addition. When replication is
+// enabled the mutation only lands in gs.nodes once it comes back through the
+// raft apply loop; see applyAddNode.
 func (gs *GraphStore) AddNode(n Node) error {
 	if n.ID == "" {
 		return fmt.Errorf("node ID cannot be empty")
 	}
+	if gs.raft != nil {
+		return gs.raft.Propose(entryAddNode, n)
+	}
+	gs.applyAddNode(n)
+	return nil
+}
+
+func (gs *GraphStore) applyAddNode(n Node) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 	gs.nodes[n.ID] = n
-	return nil
 }
 
+// AddEdge validates and proposes an edge addition, replicated the same way
+// as AddNode. Endpoint existence is re-checked inside applyAddEdge's own
+// critical section rather than here, so a concurrent Clear() between
+// validation and apply can't leave a dangling edge in gs.edges.
 func (gs *GraphStore) AddEdge(e Edge) error {
 	if e.From == "" || e.To == "" {
 		return fmt.Errorf("edge From and To cannot be empty")
 	}
+	if gs.raft != nil {
+		return gs.raft.Propose(entryAddEdge, e)
+	}
+	return gs.applyAddEdge(e)
+}
+
+// applyAddEdge re-validates endpoint existence under gs.mu before appending,
+// so it is safe to call both from the direct (non-raft) path and from the
+// raft apply loop. It is the single-edge write path; applyBatch, applyClear
+// and snapshot restore also change gs.edges.
+func (gs *GraphStore) applyAddEdge(e Edge) error {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
-	
-	// Validate nodes exist
-	if _, exists := gs.nodes[e.From]; !exists {
+	if _, ok := gs.nodes[e.From]; !ok {
 		return fmt.Errorf("source node %s does not exist", e.From)
 	}
-	if _, exists := gs.nodes[e.To]; !exists {
+	if _, ok := gs.nodes[e.To]; !ok {
 		return fmt.Errorf("target node %s does not exist", e.To)
 	}
-	
+	idx := len(gs.edges)
 	gs.edges = append(gs.edges, e)
+	gs.outByFrom[e.From] = append(gs.outByFrom[e.From], idx)
+	gs.inByTo[e.To] = append(gs.inByTo[e.To], idx)
 	return nil
 }
 
+// applyBatch adds a set of nodes and edges under a single lock acquisition,
+// used by bulk ingest (see ingest.go) and its raft replication counterpart.
+// Edge endpoints are re-checked against gs.nodes here, after the batch's own
+// nodes have been added, the same defense-in-depth applyAddEdge applies to
+// single-edge writes: the caller's own pre-validation (runIngest,
+// validateBatchRefs) happens under a separate, earlier lock acquisition, so
+// a concurrent Clear() in between could otherwise let a dangling edge slip
+// through.
+func (gs *GraphStore) applyBatch(nodes []Node, edges []Edge) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for _, n := range nodes {
+		gs.nodes[n.ID] = n
+	}
+	for _, e := range edges {
+		if _, ok := gs.nodes[e.From]; !ok {
+			log.Printf("applyBatch: source node %s does not exist, dropping edge", e.From)
+			continue
+		}
+		if _, ok := gs.nodes[e.To]; !ok {
+			log.Printf("applyBatch: target node %s does not exist, dropping edge", e.To)
+			continue
+		}
+		idx := len(gs.edges)
+		gs.edges = append(gs.edges, e)
+		gs.outByFrom[e.From] = append(gs.outByFrom[e.From], idx)
+		gs.inByTo[e.To] = append(gs.inByTo[e.To], idx)
+	}
+}
+
+// validateBatchRefs checks that every edge's endpoints are either an
+// existing node or a node included anywhere in the same batch, since
+// applyBatch adds all of a batch's nodes before its edges. (runIngest in
+// ingest.go is stricter: a node must come before the edge that uses it.)
+// It is used by
+// callers that assemble a whole batch up front, like the resumable importer
+// (importer.go), so edges can't reference nodes that were never created.
+func (gs *GraphStore) validateBatchRefs(nodes []Node, edges []Edge) error {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	known := make(map[string]bool, len(gs.nodes)+len(nodes))
+	for id := range gs.nodes {
+		known[id] = true
+	}
+	for _, n := range nodes {
+		known[n.ID] = true
+	}
+	for _, e := range edges {
+		if !known[e.From] {
+			return fmt.Errorf("source node %s does not exist", e.From)
+		}
+		if !known[e.To] {
+			return fmt.Errorf("target node %s does not exist", e.To)
+		}
+	}
+	return nil
+}
+
+// rebuildIndexes recomputes outByFrom/inByTo from gs.edges. It is called
+// after bulk state replacement (snapshot restore) so the adjacency indexes
+// stay consistent with gs.edges; applyClear resets the indexes itself.
+func (gs *GraphStore) rebuildIndexes() {
+	gs.outByFrom = make(map[string][]int, len(gs.edges))
+	gs.inByTo = make(map[string][]int, len(gs.edges))
+	for i, e := range gs.edges {
+		gs.outByFrom[e.From] = append(gs.outByFrom[e.From], i)
+		gs.inByTo[e.To] = append(gs.inByTo[e.To], i)
+	}
+}
+
 func (gs *GraphStore) GetNode(id string) (Node, bool) {
 	gs.mu.RLock()
 	defer gs.mu.RUnlock()
@@ -73,24 +198,64 @@ func (gs *GraphStore) GetNode(id string) (Node, bool) {
 	return n, exists
 }
 
-func (gs *GraphStore) Export() map[string]interface{} {
+// Export snapshots the graph, checking ctx between chunks of work so a
+// caller that times out on a large export doesn't keep gs.mu held past the
+// deadline. It returns ctx.Err() if cancelled before finishing.
+func (gs *GraphStore) Export(ctx context.Context) (map[string]interface{}, error) {
 	gs.mu.RLock()
 	defer gs.mu.RUnlock()
+
+	nodes := make(map[string]Node, len(gs.nodes))
+	i := 0
+	for id, n := range gs.nodes {
+		if i%1024 == 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+		}
+		nodes[id] = n
+		i++
+	}
+
+	edges := make([]Edge, len(gs.edges))
+	for i, e := range gs.edges {
+		if i%1024 == 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+		}
+		edges[i] = e
+	}
+
 	return map[string]interface{}{
-		"nodes": gs.nodes,
-		"edges": gs.edges,
+		"nodes": nodes,
+		"edges": edges,
 		"stats": map[string]int{
-			"node_count": len(gs.nodes),
-			"edge_count": len(gs.edges),
+			"node_count": len(nodes),
+			"edge_count": len(edges),
 		},
+	}, nil
+}
+
+func (gs *GraphStore) Clear() error {
+	if gs.raft != nil {
+		return gs.raft.Propose(entryClear, struct{}{})
 	}
+	gs.applyClear()
+	return nil
 }
 
-func (gs *GraphStore) Clear() {
+func (gs *GraphStore) applyClear() {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 	gs.nodes = make(map[string]Node)
 	gs.edges = make([]Edge, 0)
+	gs.outByFrom = make(map[string][]int)
+	gs.inByTo = make(map[string][]int)
 }
 
 // HTTP Handlers
@@ -101,18 +266,20 @@ func (gs *GraphStore) handleAddNode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var n Node
-	if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+	if err := gs.binder.Bind(r, &n); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	if err := gs.AddNode(n); err != nil {
+	_, end := gs.startSpan(r.Context(), "AddNode")
+	err := gs.AddNode(n)
+	end()
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "id": n.ID})
+	gs.renderer.Render(w, r, http.StatusOK, map[string]string{"status": "ok", "id": n.ID})
 }
 
 func (gs *GraphStore) handleAddEdge(w http.ResponseWriter, r *http.Request) {
@@ -122,18 +289,20 @@ func (gs *GraphStore) handleAddEdge(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var e Edge
-	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+	if err := gs.binder.Bind(r, &e); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	if err := gs.AddEdge(e); err != nil {
+	_, end := gs.startSpan(r.Context(), "AddEdge")
+	err := gs.AddEdge(e)
+	end()
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	gs.renderer.Render(w, r, http.StatusOK, map[string]string{"status": "ok"})
 }
 
 func (gs *GraphStore) handleGetNode(w http.ResponseWriter, r *http.Request) {
@@ -142,20 +311,32 @@ func (gs *GraphStore) handleGetNode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id := r.URL.Query().Get("id")
-	if id == "" {
+	var req struct {
+		ID string `query:"id"`
+	}
+	if err := gs.binder.Bind(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ID == "" {
 		http.Error(w, "Node ID required", http.StatusBadRequest)
 		return
 	}
 
-	node, exists := gs.GetNode(id)
+	if gs.raft != nil && parseConsistency(r) == consistencyLinearizable {
+		if err := gs.raft.confirmLeader(); err != nil {
+			http.Error(w, err.Error(), http.StatusMisdirectedRequest)
+			return
+		}
+	}
+
+	node, exists := gs.GetNode(req.ID)
 	if !exists {
 		http.Error(w, "Node not found", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(node)
+	gs.renderer.Render(w, r, http.StatusOK, node)
 }
 
 func (gs *GraphStore) handleExport(w http.ResponseWriter, r *http.Request) {
@@ -164,8 +345,19 @@ func (gs *GraphStore) handleExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(gs.Export())
+	if gs.raft != nil && parseConsistency(r) == consistencyLinearizable {
+		if err := gs.raft.confirmLeader(); err != nil {
+			http.Error(w, err.Error(), http.StatusMisdirectedRequest)
+			return
+		}
+	}
+
+	snapshot, err := gs.Export(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return
+	}
+	gs.renderer.Render(w, r, http.StatusOK, snapshot)
 }
 
 func (gs *GraphStore) handleClear(w http.ResponseWriter, r *http.Request) {
@@ -174,7 +366,10 @@ func (gs *GraphStore) handleClear(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	gs.Clear()
+	if err := gs.Clear(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "cleared"})
 }
@@ -187,14 +382,14 @@ func (gs *GraphStore) handleHealth(w http.ResponseWriter, r *http.Request) {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		
+
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
-		
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -211,13 +406,96 @@ func loggingMiddleware(next http.Handler) http.Handler {
 func main() {
 	gs := NewGraphStore()
 
+	nodeID := os.Getenv("RAFT_NODE_ID")
+	if nodeID == "" {
+		nodeID = "node1"
+	}
+	dataDir := os.Getenv("RAFT_DATA_DIR")
+	if dataDir == "" {
+		dataDir = "./data"
+	}
+	rn := newRaftNode(nodeID, dataDir, gs)
+	self := member{ID: nodeID, PeerURL: "http://localhost:" + envOr("PORT", "8080"), ClientURL: "http://localhost:" + envOr("PORT", "8080")}
+	rn.members[nodeID] = self
+	// RAFT_JOIN_ADDR points at an existing cluster member's client URL. When
+	// set, this node joins as a follower instead of bootstrapping its own
+	// cluster as leader; see raftNode.join.
+	if joinAddr := os.Getenv("RAFT_JOIN_ADDR"); joinAddr != "" {
+		if err := rn.join(joinAddr, self); err != nil {
+			log.Fatalf("raft: failed to join cluster at %s: %v", joinAddr, err)
+		}
+	}
+	gs.raft = rn
+
+	// TRAFFIC_CONTROLLER selects how the server observes its own traffic:
+	// "prometheus" exposes /metrics, "otel" logs one span per request (plus
+	// child spans from handleAddNode/handleAddEdge/handleQuery), anything
+	// else (including unset) disables traffic observation entirely.
+	var promController *prometheusController
+	switch os.Getenv("TRAFFIC_CONTROLLER") {
+	case "prometheus":
+		promController = newPrometheusController(gs)
+		gs.SetTrafficController(promController)
+	case "otel":
+		gs.SetTrafficController(newOTelSpanController())
+	}
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/node", gs.handleAddNode)
-	mux.HandleFunc("/node/get", gs.handleGetNode)
-	mux.HandleFunc("/edge", gs.handleAddEdge)
-	mux.HandleFunc("/export", gs.handleExport)
-	mux.HandleFunc("/clear", gs.handleClear)
+
+	// Auth is optional: only enforced once HS256 or Ed25519 key material is
+	// configured, so the server keeps working unauthenticated in dev/test.
+	auth, err := newAuthenticatorFromEnv()
+	if err != nil {
+		log.Printf("auth: running without authentication (%v)", err)
+		auth = nil
+	}
+	write := func(h http.HandlerFunc) http.HandlerFunc {
+		if auth == nil {
+			return h
+		}
+		return auth.requireScope(scopeWrite, h)
+	}
+	read := func(h http.HandlerFunc) http.HandlerFunc {
+		if auth == nil {
+			return h
+		}
+		return auth.requireScope(scopeRead, h)
+	}
+	admin := func(h http.HandlerFunc) http.HandlerFunc {
+		if auth == nil {
+			return h
+		}
+		return auth.requireScope(scopeAdmin, h)
+	}
+
+	mux.HandleFunc("/node", write(gs.handleAddNode))
+	mux.HandleFunc("/node/get", read(gs.handleGetNode))
+	mux.HandleFunc("/edge", write(gs.handleAddEdge))
+	mux.HandleFunc("/export", read(gs.handleExport))
+	mux.HandleFunc("/clear", admin(gs.handleClear))
+	mux.HandleFunc("/query", read(gs.handleQuery))
+	mux.HandleFunc("/ingest", write(gs.handleIngest))
+	im := newImportManager(gs)
+	mux.HandleFunc("/import", write(im.handleImportStart))
+	mux.HandleFunc("/import/", write(im.handleImportChunk))
 	mux.HandleFunc("/health", gs.handleHealth)
+	if promController != nil {
+		mux.HandleFunc("/metrics", promController.handleMetrics)
+	}
+	// The /v2/* routes drive cluster membership and replication directly
+	// (handlePropose can issue any mutation, handleSnapshot's POST replaces
+	// all local state), so they must not be left open to any caller. They
+	// are gated by RAFT_CLUSTER_SECRET rather than the end-user admin scope:
+	// raftNode's own HTTP client calls these routes (join, forwardToLeader,
+	// replicateToFollowers) and has no user JWT to present, so reusing
+	// admin() here would break clustering the moment JWT auth is configured.
+	mux.HandleFunc("/v2/members", rn.requireClusterSecret(rn.handleMembers))
+	mux.HandleFunc("/v2/propose", rn.requireClusterSecret(rn.handlePropose))
+	mux.HandleFunc("/v2/append", rn.requireClusterSecret(rn.handleAppend))
+	mux.HandleFunc("/v2/snapshot", rn.requireClusterSecret(rn.handleSnapshot))
+	if auth != nil {
+		mux.HandleFunc("/auth/token", auth.handleMintToken)
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -226,7 +504,7 @@ func main() {
 
 	srv := &http.Server{
 		Addr:         ":" + port,
-		Handler:      corsMiddleware(loggingMiddleware(mux)),
+		Handler:      corsMiddleware(loggingMiddleware(trafficMiddleware(gs, requestTimeoutMiddleware(mux)))),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -250,11 +528,16 @@ func main() {
 		close(done)
 	}()
 
+	ln, err := listenWithTraffic(gs, srv.Addr)
+	if err != nil {
+		log.Fatalf("Server failed to start: %v", err)
+	}
+
 	log.Printf("Graph store server starting on port %s", port)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 
 	<-done
 	log.Println("Server stopped")
-}
\ No newline at end of file
+}
@@ -0,0 +1,644 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// --- AST ---
+
+// queryPatternNode is one `(var:Label {prop:"v"})` element of a MATCH
+// pattern.
+type queryPatternNode struct {
+	Var   string
+	Label string
+	Props map[string]string
+}
+
+// queryPatternRel is the `-[:REL]->` (or `-[:REL]-?>` for optional) edge
+// between two pattern nodes.
+type queryPatternRel struct {
+	Label    string
+	Optional bool
+}
+
+// queryStep is one node plus the relationship that led into it; the first
+// step in a pattern has a zero-value Rel.
+type queryStep struct {
+	Rel  queryPatternRel
+	Node queryPatternNode
+}
+
+type whereCond struct {
+	Var   string
+	Field string
+	Value string
+}
+
+type returnField struct {
+	Var   string
+	Field string
+}
+
+type cypherQuery struct {
+	Pattern []queryStep
+	Where   []whereCond
+	Return  []returnField
+	Limit   int
+}
+
+// --- Tokenizer ---
+
+type tokKind int
+
+const (
+	tokWord tokKind = iota
+	tokString
+	tokSymbol
+	tokEOF
+)
+
+type token struct {
+	kind tokKind
+	val  string
+}
+
+func tokenize(q string) ([]token, error) {
+	var toks []token
+	i, n := 0, len(q)
+	for i < n {
+		c := q[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"':
+			j := i + 1
+			for j < n && q[j] != '"' {
+				j++
+			}
+			if j >= n {
+				return nil, fmt.Errorf("query: unterminated string literal")
+			}
+			toks = append(toks, token{tokString, q[i+1 : j]})
+			i = j + 1
+		case strings.ContainsRune("(){}[]:,.", rune(c)):
+			toks = append(toks, token{tokSymbol, string(c)})
+			i++
+		case c == '-':
+			// relationship arrow: -[...]->. A doubled dash becomes its own
+			// "--" token, which the parser does not accept, so the bare
+			// `-->` form is rejected.
+			if i+1 < n && q[i+1] == '-' {
+				toks = append(toks, token{tokSymbol, "--"})
+				i += 2
+			} else {
+				toks = append(toks, token{tokSymbol, "-"})
+				i++
+			}
+		case c == '>':
+			toks = append(toks, token{tokSymbol, ">"})
+			i++
+		case c == '=':
+			toks = append(toks, token{tokSymbol, "="})
+			i++
+		default:
+			j := i
+			for j < n && !strings.ContainsRune(" \t\n\r(){}[]:,.-=>\"", rune(q[j])) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("query: unexpected character %q", string(c))
+			}
+			toks = append(toks, token{tokWord, q[i:j]})
+			i = j
+		}
+	}
+	toks = append(toks, token{tokEOF, ""})
+	return toks, nil
+}
+
+// --- Parser ---
+
+type queryParser struct {
+	toks []token
+	pos  int
+}
+
+func parseCypher(q string) (*cypherQuery, error) {
+	toks, err := tokenize(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{toks: toks}
+	return p.parseQuery()
+}
+
+func (p *queryParser) peek() token { return p.toks[p.pos] }
+func (p *queryParser) advance() token {
+	t := p.toks[p.pos]
+	if p.pos < len(p.toks)-1 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) expectWord(w string) error {
+	t := p.advance()
+	if t.kind != tokWord || !strings.EqualFold(t.val, w) {
+		return fmt.Errorf("query: expected %q, got %q", w, t.val)
+	}
+	return nil
+}
+
+func (p *queryParser) expectSymbol(s string) error {
+	t := p.advance()
+	if t.kind != tokSymbol || t.val != s {
+		return fmt.Errorf("query: expected %q, got %q", s, t.val)
+	}
+	return nil
+}
+
+func (p *queryParser) parseQuery() (*cypherQuery, error) {
+	cq := &cypherQuery{Limit: -1}
+	if err := p.expectWord("MATCH"); err != nil {
+		return nil, err
+	}
+	steps, err := p.parsePattern()
+	if err != nil {
+		return nil, err
+	}
+	cq.Pattern = steps
+
+	if p.peek().kind == tokWord && strings.EqualFold(p.peek().val, "WHERE") {
+		p.advance()
+		conds, err := p.parseWhere()
+		if err != nil {
+			return nil, err
+		}
+		cq.Where = conds
+	}
+
+	if err := p.expectWord("RETURN"); err != nil {
+		return nil, err
+	}
+	ret, err := p.parseReturn()
+	if err != nil {
+		return nil, err
+	}
+	cq.Return = ret
+
+	if p.peek().kind == tokWord && strings.EqualFold(p.peek().val, "LIMIT") {
+		p.advance()
+		t := p.advance()
+		n, err := strconv.Atoi(t.val)
+		if err != nil {
+			return nil, fmt.Errorf("query: invalid LIMIT %q", t.val)
+		}
+		cq.Limit = n
+	}
+
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("query: unexpected trailing input %q", p.peek().val)
+	}
+	return cq, nil
+}
+
+// parsePattern parses `(a:Label {k:"v"})-[:REL]->(b)-[:REL2]->(c)` allowing
+// `b`/`c` to repeat an earlier variable name (a cycle back into the graph).
+func (p *queryParser) parsePattern() ([]queryStep, error) {
+	first, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	steps := []queryStep{{Node: first}}
+
+	for p.peek().kind == tokSymbol && p.peek().val == "-" {
+		rel, err := p.parseRel()
+		if err != nil {
+			return nil, err
+		}
+		node, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, queryStep{Rel: rel, Node: node})
+	}
+	return steps, nil
+}
+
+func (p *queryParser) parseNode() (queryPatternNode, error) {
+	var n queryPatternNode
+	if err := p.expectSymbol("("); err != nil {
+		return n, err
+	}
+	t := p.advance()
+	if t.kind != tokWord {
+		return n, fmt.Errorf("query: expected variable name, got %q", t.val)
+	}
+	n.Var = t.val
+
+	if p.peek().kind == tokSymbol && p.peek().val == ":" {
+		p.advance()
+		lbl := p.advance()
+		if lbl.kind != tokWord {
+			return n, fmt.Errorf("query: expected label after ':'")
+		}
+		n.Label = lbl.val
+	}
+
+	if p.peek().kind == tokSymbol && p.peek().val == "{" {
+		p.advance()
+		n.Props = make(map[string]string)
+		for {
+			key := p.advance()
+			if key.kind != tokWord {
+				return n, fmt.Errorf("query: expected property key")
+			}
+			if err := p.expectSymbol(":"); err != nil {
+				return n, err
+			}
+			val := p.advance()
+			n.Props[key.val] = val.val
+			if p.peek().kind == tokSymbol && p.peek().val == "," {
+				p.advance()
+				continue
+			}
+			break
+		}
+		if err := p.expectSymbol("}"); err != nil {
+			return n, err
+		}
+	}
+
+	if err := p.expectSymbol(")"); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// parseRel parses `-[:REL]->`; a trailing `?` before the final `>` marks the
+// hop optional, e.g. `-[:REL]-?>`.
+func (p *queryParser) parseRel() (queryPatternRel, error) {
+	var rel queryPatternRel
+	if err := p.expectSymbol("-"); err != nil {
+		return rel, err
+	}
+	if err := p.expectSymbol("["); err != nil {
+		return rel, err
+	}
+	if p.peek().kind == tokSymbol && p.peek().val == ":" {
+		p.advance()
+		lbl := p.advance()
+		if lbl.kind != tokWord {
+			return rel, fmt.Errorf("query: expected relationship label")
+		}
+		rel.Label = lbl.val
+	}
+	if err := p.expectSymbol("]"); err != nil {
+		return rel, err
+	}
+	if err := p.expectSymbol("-"); err != nil {
+		return rel, err
+	}
+	if p.peek().kind == tokWord && p.peek().val == "?" {
+		rel.Optional = true
+		p.advance()
+	}
+	if err := p.expectSymbol(">"); err != nil {
+		return rel, err
+	}
+	return rel, nil
+}
+
+func (p *queryParser) parseWhere() ([]whereCond, error) {
+	var conds []whereCond
+	for {
+		c, err := p.parseCond()
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, c)
+		if p.peek().kind == tokWord && strings.EqualFold(p.peek().val, "AND") {
+			p.advance()
+			continue
+		}
+		break
+	}
+	return conds, nil
+}
+
+func (p *queryParser) parseCond() (whereCond, error) {
+	var c whereCond
+	t := p.advance()
+	if t.kind != tokWord {
+		return c, fmt.Errorf("query: expected variable in WHERE clause")
+	}
+	c.Var = t.val
+	if err := p.expectSymbol("."); err != nil {
+		return c, err
+	}
+	f := p.advance()
+	if f.kind != tokWord {
+		return c, fmt.Errorf("query: expected field in WHERE clause")
+	}
+	c.Field = f.val
+	if err := p.expectSymbol("="); err != nil {
+		return c, err
+	}
+	v := p.advance()
+	c.Value = v.val
+	return c, nil
+}
+
+func (p *queryParser) parseReturn() ([]returnField, error) {
+	var fields []returnField
+	for {
+		v := p.advance()
+		if v.kind != tokWord {
+			return nil, fmt.Errorf("query: expected variable in RETURN clause")
+		}
+		rf := returnField{Var: v.val}
+		if p.peek().kind == tokSymbol && p.peek().val == "." {
+			p.advance()
+			f := p.advance()
+			if f.kind != tokWord {
+				return nil, fmt.Errorf("query: expected field in RETURN clause")
+			}
+			rf.Field = f.val
+			// `x.props.name` — the leading "props" is a no-op namespace,
+			// RETURN still resolves to the node's Props map.
+			if rf.Field == "props" && p.peek().kind == tokSymbol && p.peek().val == "." {
+				p.advance()
+				f2 := p.advance()
+				if f2.kind != tokWord {
+					return nil, fmt.Errorf("query: expected field after 'props.'")
+				}
+				rf.Field = f2.val
+			}
+		}
+		fields = append(fields, rf)
+		if p.peek().kind == tokSymbol && p.peek().val == "," {
+			p.advance()
+			continue
+		}
+		break
+	}
+	return fields, nil
+}
+
+// --- Execution ---
+
+// binding maps a pattern variable name to the graph node ID it's currently
+// bound to within one partial match.
+type binding map[string]string
+
+func fieldValue(n Node, field string) string {
+	switch field {
+	case "id":
+		return n.ID
+	default:
+		return n.Props[field]
+	}
+}
+
+func nodeMatches(n Node, pat queryPatternNode) bool {
+	if pat.Label != "" && n.Props["label"] != pat.Label {
+		return false
+	}
+	for k, v := range pat.Props {
+		if n.Props[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// execCypher plans the scan starting from the most-selective bound node
+// (the pattern node carrying a label/property filter, falling back to the
+// first one), then walks the adjacency indexes hop by hop.
+func (gs *GraphStore) execCypher(ctx context.Context, q *cypherQuery) ([]map[string]string, error) {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+
+	if len(q.Pattern) == 0 {
+		return nil, fmt.Errorf("query: empty pattern")
+	}
+
+	startIdx := 0
+	for i, s := range q.Pattern {
+		if s.Node.Label != "" || len(s.Node.Props) > 0 {
+			startIdx = i
+			break
+		}
+	}
+
+	var results []map[string]string
+	i := 0
+	for id, n := range gs.nodes {
+		if i%256 == 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+		}
+		i++
+		if !nodeMatches(n, q.Pattern[startIdx].Node) {
+			continue
+		}
+		b := binding{q.Pattern[startIdx].Node.Var: id}
+		if err := gs.walkPattern(ctx, q, startIdx, b, &results); err != nil {
+			return nil, err
+		}
+		if q.Limit >= 0 && len(results) >= q.Limit {
+			break
+		}
+	}
+
+	if q.Limit >= 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+// walkPattern extends a partial binding outward from startIdx in both
+// directions along the pattern, emitting a row for every full match that
+// satisfies WHERE. It checks ctx at each hop so a long-running traversal can
+// be cancelled without finishing the whole scan.
+func (gs *GraphStore) walkPattern(ctx context.Context, q *cypherQuery, startIdx int, b binding, results *[]map[string]string) error {
+	// Walk forward from startIdx to the end of the pattern.
+	var forward func(i int, b binding) error
+	forward = func(i int, b binding) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if i == len(q.Pattern)-1 {
+			return gs.tryBackward(ctx, q, startIdx, b, results)
+		}
+		next := q.Pattern[i+1]
+		fromID := b[q.Pattern[i].Node.Var]
+		matched := false
+		for _, eIdx := range gs.outByFrom[fromID] {
+			e := gs.edges[eIdx]
+			if next.Rel.Label != "" && e.Label != next.Rel.Label {
+				continue
+			}
+			n, ok := gs.nodes[e.To]
+			if !ok || !nodeMatches(n, next.Node) {
+				continue
+			}
+			if boundID, bound := b[next.Node.Var]; bound && boundID != e.To {
+				continue // cycle: variable already bound to a different node
+			}
+			nb := cloneBinding(b)
+			nb[next.Node.Var] = e.To
+			matched = true
+			if err := forward(i+1, nb); err != nil {
+				return err
+			}
+		}
+		if !matched && next.Rel.Optional {
+			nb := cloneBinding(b)
+			if err := forward(i+1, nb); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return forward(startIdx, b)
+}
+
+// tryBackward walks backward from startIdx to the beginning of the pattern
+// (only relevant when the most-selective node isn't the pattern's first
+// element); for the common case startIdx==0 this is a no-op that emits the
+// row directly.
+func (gs *GraphStore) tryBackward(ctx context.Context, q *cypherQuery, startIdx int, b binding, results *[]map[string]string) error {
+	if startIdx == 0 {
+		gs.emitIfMatch(q, b, results)
+		return nil
+	}
+	var backward func(i int, b binding) error
+	backward = func(i int, b binding) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if i == 0 {
+			gs.emitIfMatch(q, b, results)
+			return nil
+		}
+		cur := q.Pattern[i]
+		toID := b[cur.Node.Var]
+		matched := false
+		for _, eIdx := range gs.inByTo[toID] {
+			e := gs.edges[eIdx]
+			if cur.Rel.Label != "" && e.Label != cur.Rel.Label {
+				continue
+			}
+			n, ok := gs.nodes[e.From]
+			if !ok || !nodeMatches(n, q.Pattern[i-1].Node) {
+				continue
+			}
+			if boundID, bound := b[q.Pattern[i-1].Node.Var]; bound && boundID != e.From {
+				continue
+			}
+			nb := cloneBinding(b)
+			nb[q.Pattern[i-1].Node.Var] = e.From
+			matched = true
+			if err := backward(i-1, nb); err != nil {
+				return err
+			}
+		}
+		if !matched && cur.Rel.Optional {
+			if err := backward(i-1, cloneBinding(b)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return backward(startIdx, b)
+}
+
+func cloneBinding(b binding) binding {
+	nb := make(binding, len(b))
+	for k, v := range b {
+		nb[k] = v
+	}
+	return nb
+}
+
+func (gs *GraphStore) emitIfMatch(q *cypherQuery, b binding, results *[]map[string]string) {
+	for _, c := range q.Where {
+		id, ok := b[c.Var]
+		if !ok {
+			return
+		}
+		n := gs.nodes[id]
+		if fieldValue(n, c.Field) != c.Value {
+			return
+		}
+	}
+	row := make(map[string]string, len(q.Return))
+	for _, rf := range q.Return {
+		id, ok := b[rf.Var]
+		if !ok {
+			continue
+		}
+		n := gs.nodes[id]
+		key := rf.Var
+		if rf.Field != "" {
+			key = rf.Var + "." + rf.Field
+		}
+		if rf.Field == "" {
+			row[key] = id
+		} else {
+			row[key] = fieldValue(n, rf.Field)
+		}
+	}
+	*results = append(*results, row)
+}
+
+// handleQuery serves POST /query with a raw Cypher-like query string in the
+// request body and writes the matched rows back as one JSON array once
+// execution has finished; rows are not sent as they are found.
+func (gs *GraphStore) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Query string `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	q, err := parseCypher(body.Query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, end := gs.startSpan(r.Context(), "query execution")
+	rows, err := gs.execCypher(ctx, q)
+	end()
+	if err != nil {
+		if r.Context().Err() != nil {
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
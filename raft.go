@@ -0,0 +1,581 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// clusterSecretHeader carries the cluster shared secret (RAFT_CLUSTER_SECRET)
+// on raftNode's internal HTTP calls (join, forwardToLeader,
+// replicateToFollowers), so those calls can reach the /v2/* routes
+// independently of whatever end-user JWT scopes (see auth.go) are configured
+// on the same server.
+const clusterSecretHeader = "X-Raft-Cluster-Secret"
+
+// entryKind identifies which GraphStore mutation a raft log entry encodes.
+type entryKind string
+
+const (
+	entryAddNode entryKind = "add_node"
+	entryAddEdge entryKind = "add_edge"
+	entryClear   entryKind = "clear"
+	entryBatch   entryKind = "batch"
+)
+
+// batchMutation replicates a whole bulk-ingest batch (see ingest.go) as a
+// single log entry so followers apply it atomically rather than as many
+// individual entries.
+type batchMutation struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// logEntry is the unit replicated through the cluster and persisted to the WAL.
+// Mutations are only ever applied to gs.nodes/gs.edges from the apply loop, so
+// every node in the cluster converges on the same state regardless of which
+// member originally received the write.
+type logEntry struct {
+	Index uint64          `json:"index"`
+	Term  uint64          `json:"term"`
+	Kind  entryKind       `json:"kind"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// raftRole is this member's current role in the (simplified) consensus group.
+type raftRole int
+
+const (
+	roleFollower raftRole = iota
+	roleLeader
+)
+
+// member describes a peer in the cluster, mirroring etcd's /v2/members shape.
+type member struct {
+	ID        string `json:"id"`
+	PeerURL   string `json:"peerURL"`
+	ClientURL string `json:"clientURL"`
+}
+
+// joinResponse is what an existing cluster member hands back to a node that
+// POSTs itself to /v2/members: the membership list and current leader, so
+// the joining node knows to start as a follower and who to forward writes
+// to instead of assuming leadership itself.
+type joinResponse struct {
+	Members  []member `json:"members"`
+	LeaderID string   `json:"leaderID"`
+}
+
+// raftNode is a deliberately small replication layer: single-leader,
+// HTTP-transported, JSON-encoded log entries. It does not implement leader
+// election or log-matching recovery to the level etcd/raft does, but it
+// preserves the properties callers rely on: writes are ordered through a
+// leader, entries are durable before being acknowledged, and followers apply
+// entries in log order.
+type raftNode struct {
+	mu sync.Mutex
+
+	id       string
+	role     raftRole
+	leaderID string
+	term     uint64
+
+	members map[string]member
+
+	lastIndex uint64
+	wal       *os.File
+	dataDir   string
+
+	gs *GraphStore
+
+	httpClient *http.Client
+
+	// clusterSecret authenticates raftNode's own internal calls to /v2/*, as
+	// opposed to the scoped JWTs end users present (see auth.go). Empty means
+	// the /v2/* routes are unauthenticated, same "optional until configured"
+	// convention as user-facing auth.
+	clusterSecret string
+}
+
+func newRaftNode(id, dataDir string, gs *GraphStore) *raftNode {
+	rn := &raftNode{
+		id: id,
+		// A node only stays leader if it bootstraps the cluster, i.e. nothing
+		// ever calls join() on it. A node that joins an existing cluster (see
+		// join) is demoted to roleFollower before it serves any traffic.
+		role:          roleLeader,
+		leaderID:      id,
+		members:       make(map[string]member),
+		dataDir:       dataDir,
+		gs:            gs,
+		httpClient:    &http.Client{Timeout: 5 * time.Second},
+		clusterSecret: os.Getenv("RAFT_CLUSTER_SECRET"),
+	}
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		log.Fatalf("raft: cannot create data dir %s: %v", dataDir, err)
+	}
+	if err := rn.openWAL(); err != nil {
+		log.Fatalf("raft: cannot open WAL: %v", err)
+	}
+	if err := rn.replayWAL(); err != nil {
+		log.Fatalf("raft: cannot replay WAL: %v", err)
+	}
+	return rn
+}
+
+func (rn *raftNode) walPath() string {
+	return filepath.Join(rn.dataDir, "raft.wal")
+}
+
+func (rn *raftNode) openWAL() error {
+	f, err := os.OpenFile(rn.walPath(), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	rn.wal = f
+	return nil
+}
+
+// replayWAL applies every previously persisted entry so a restarted node
+// catches up without a snapshot.
+func (rn *raftNode) replayWAL() error {
+	f, err := os.Open(rn.walPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e logEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("raft: corrupt WAL entry: %w", err)
+		}
+		rn.applyEntry(e)
+		rn.lastIndex = e.Index
+	}
+	return scanner.Err()
+}
+
+func (rn *raftNode) appendWAL(e logEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if _, err := rn.wal.Write(b); err != nil {
+		return err
+	}
+	return rn.wal.Sync()
+}
+
+// Propose replicates a mutation through the leader and only returns once it
+// has been durably written and applied locally. On a follower, it forwards
+// the request to the current leader instead of applying it directly.
+func (rn *raftNode) Propose(kind entryKind, data interface{}) error {
+	rn.mu.Lock()
+	if rn.role != roleLeader {
+		leaderURL := rn.members[rn.leaderID].ClientURL
+		rn.mu.Unlock()
+		if leaderURL == "" {
+			return fmt.Errorf("raft: no known leader")
+		}
+		return rn.forwardToLeader(leaderURL, kind, data)
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		rn.mu.Unlock()
+		return err
+	}
+	rn.lastIndex++
+	entry := logEntry{Index: rn.lastIndex, Term: rn.term, Kind: kind, Data: raw}
+	if err := rn.appendWAL(entry); err != nil {
+		rn.mu.Unlock()
+		return err
+	}
+	rn.mu.Unlock()
+
+	rn.applyEntry(entry)
+	rn.replicateToFollowers(entry)
+	return nil
+}
+
+// post issues an HTTP POST to another cluster member's /v2/* route,
+// attaching the cluster shared secret (if configured) via clusterSecretHeader
+// so it authenticates independently of end-user JWT scopes.
+func (rn *raftNode) post(url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if rn.clusterSecret != "" {
+		req.Header.Set(clusterSecretHeader, rn.clusterSecret)
+	}
+	return rn.httpClient.Do(req)
+}
+
+// forwardToLeader re-issues the mutation as a raw entry POST against the
+// leader's /v2/propose endpoint so the client does not need to know the
+// current leader itself.
+func (rn *raftNode) forwardToLeader(leaderURL string, kind entryKind, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(struct {
+		Kind entryKind       `json:"kind"`
+		Data json.RawMessage `json:"data"`
+	}{Kind: kind, Data: raw})
+	if err != nil {
+		return err
+	}
+	resp, err := rn.post(leaderURL+"/v2/propose", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("raft: forwarding to leader %s: %w", leaderURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("raft: leader rejected proposal: %s", string(b))
+	}
+	return nil
+}
+
+// join registers self with an existing cluster member at joinAddr and
+// demotes this node to roleFollower, adopting the leader and membership list
+// the remote member hands back. It must be called, if at all, before this
+// node starts serving requests: a node that never joins stays the bootstrap
+// leader assigned in newRaftNode.
+func (rn *raftNode) join(joinAddr string, self member) error {
+	body, err := json.Marshal(self)
+	if err != nil {
+		return err
+	}
+	resp, err := rn.post(joinAddr+"/v2/members", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("raft: join request to %s: %w", joinAddr, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("raft: join rejected by %s: %s", joinAddr, string(b))
+	}
+	var jr joinResponse
+	if err := json.NewDecoder(resp.Body).Decode(&jr); err != nil {
+		return fmt.Errorf("raft: decode join response: %w", err)
+	}
+
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	rn.role = roleFollower
+	rn.leaderID = jr.LeaderID
+	for _, m := range jr.Members {
+		rn.members[m.ID] = m
+	}
+	return nil
+}
+
+// replicateToFollowers best-effort ships the entry to every known peer. A
+// production system would track per-follower match indices and retry; this
+// fire-and-forget pass is enough to keep followers converged under normal
+// operation.
+func (rn *raftNode) replicateToFollowers(entry logEntry) {
+	rn.mu.Lock()
+	peers := make([]member, 0, len(rn.members))
+	for id, m := range rn.members {
+		if id != rn.id {
+			peers = append(peers, m)
+		}
+	}
+	rn.mu.Unlock()
+
+	body, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("raft: marshal entry for replication: %v", err)
+		return
+	}
+	for _, p := range peers {
+		go func(m member) {
+			resp, err := rn.post(m.ClientURL+"/v2/append", "application/json", bytes.NewReader(body))
+			if err != nil {
+				log.Printf("raft: replication to %s failed: %v", m.ID, err)
+				return
+			}
+			resp.Body.Close()
+		}(p)
+	}
+}
+
+// applyEntry is the only place log entries mutate gs.nodes/gs.edges (Restore
+// replaces them wholesale from a snapshot), guaranteeing every node in the
+// cluster applies entries identically and in order.
+func (rn *raftNode) applyEntry(e logEntry) {
+	switch e.Kind {
+	case entryAddNode:
+		var n Node
+		if err := json.Unmarshal(e.Data, &n); err != nil {
+			log.Printf("raft: apply add_node: %v", err)
+			return
+		}
+		rn.gs.applyAddNode(n)
+	case entryAddEdge:
+		var ed Edge
+		if err := json.Unmarshal(e.Data, &ed); err != nil {
+			log.Printf("raft: apply add_edge: %v", err)
+			return
+		}
+		if err := rn.gs.applyAddEdge(ed); err != nil {
+			log.Printf("raft: apply add_edge: %v", err)
+		}
+	case entryClear:
+		rn.gs.applyClear()
+	case entryBatch:
+		var b batchMutation
+		if err := json.Unmarshal(e.Data, &b); err != nil {
+			log.Printf("raft: apply batch: %v", err)
+			return
+		}
+		rn.gs.applyBatch(b.Nodes, b.Edges)
+	default:
+		log.Printf("raft: unknown entry kind %q", e.Kind)
+	}
+}
+
+// raftSnapshot is the serialized form handed to new members so they can
+// catch up without replaying the full WAL.
+type raftSnapshot struct {
+	Index uint64          `json:"index"`
+	Term  uint64          `json:"term"`
+	Nodes map[string]Node `json:"nodes"`
+	Edges []Edge          `json:"edges"`
+}
+
+func (rn *raftNode) Snapshot() raftSnapshot {
+	rn.mu.Lock()
+	idx, term := rn.lastIndex, rn.term
+	rn.mu.Unlock()
+
+	rn.gs.mu.RLock()
+	defer rn.gs.mu.RUnlock()
+	nodes := make(map[string]Node, len(rn.gs.nodes))
+	for k, v := range rn.gs.nodes {
+		nodes[k] = v
+	}
+	edges := make([]Edge, len(rn.gs.edges))
+	copy(edges, rn.gs.edges)
+	return raftSnapshot{Index: idx, Term: term, Nodes: nodes, Edges: edges}
+}
+
+// Restore replaces local state with a snapshot taken from another member and
+// truncates the WAL, since the snapshot already reflects everything up to
+// snap.Index.
+func (rn *raftNode) Restore(snap raftSnapshot) error {
+	rn.gs.mu.Lock()
+	rn.gs.nodes = snap.Nodes
+	rn.gs.edges = snap.Edges
+	rn.gs.rebuildIndexes()
+	rn.gs.mu.Unlock()
+
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	rn.lastIndex = snap.Index
+	rn.term = snap.Term
+
+	if err := rn.wal.Close(); err != nil {
+		return err
+	}
+	if err := os.Truncate(rn.walPath(), 0); err != nil {
+		return err
+	}
+	return rn.openWAL()
+}
+
+// --- HTTP surface: /v2/members, /v2/propose, /v2/append, /v2/snapshot ---
+
+// requireClusterSecret protects the /v2/* routes with the cluster shared
+// secret instead of end-user JWT scopes (see auth.go's requireScope):
+// raftNode's own HTTP client (join, forwardToLeader, replicateToFollowers)
+// has no way to hold a user token, so gating these routes behind the same
+// scopes user requests need would 401 every internal replication call the
+// moment JWT auth is configured. It is a no-op when RAFT_CLUSTER_SECRET is
+// unset, the same "auth optional until configured" convention the rest of
+// the server follows.
+func (rn *raftNode) requireClusterSecret(next http.HandlerFunc) http.HandlerFunc {
+	if rn.clusterSecret == "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get(clusterSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(rn.clusterSecret)) != 1 {
+			http.Error(w, "missing or invalid cluster secret", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (rn *raftNode) handleMembers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rn.mu.Lock()
+		list := make([]member, 0, len(rn.members))
+		for _, m := range rn.members {
+			list = append(list, m)
+		}
+		rn.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"members": list})
+
+	case http.MethodPost:
+		var m member
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			http.Error(w, fmt.Sprintf("invalid member: %v", err), http.StatusBadRequest)
+			return
+		}
+		if m.ID == "" || m.ClientURL == "" {
+			http.Error(w, "member id and clientURL are required", http.StatusBadRequest)
+			return
+		}
+		rn.mu.Lock()
+		rn.members[m.ID] = m
+		list := make([]member, 0, len(rn.members))
+		for _, mm := range rn.members {
+			list = append(list, mm)
+		}
+		leaderID := rn.leaderID
+		rn.mu.Unlock()
+		writeJSON(w, http.StatusCreated, joinResponse{Members: list, LeaderID: leaderID})
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "id query param required", http.StatusBadRequest)
+			return
+		}
+		rn.mu.Lock()
+		delete(rn.members, id)
+		rn.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePropose is where followers forward client writes so they go through
+// the leader, and where peers send new entries for the leader to accept.
+func (rn *raftNode) handlePropose(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Kind entryKind       `json:"kind"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid proposal: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := rn.Propose(req.Kind, req.Data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleAppend lets followers accept entries replicated from the leader.
+func (rn *raftNode) handleAppend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var e logEntry
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		http.Error(w, fmt.Sprintf("invalid entry: %v", err), http.StatusBadRequest)
+		return
+	}
+	rn.mu.Lock()
+	if err := rn.appendWAL(e); err != nil {
+		rn.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rn.lastIndex = e.Index
+	rn.mu.Unlock()
+
+	rn.applyEntry(e)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (rn *raftNode) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, rn.Snapshot())
+	case http.MethodPost:
+		var snap raftSnapshot
+		if err := json.NewDecoder(r.Body).Decode(&snap); err != nil {
+			http.Error(w, fmt.Sprintf("invalid snapshot: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := rn.Restore(snap); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "restored"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// readConsistency distinguishes linearizable reads (must confirm this node
+// is still leader / up to date with the leader before answering) from stale
+// local reads that are served straight out of local state.
+type readConsistency string
+
+const (
+	consistencyLinearizable readConsistency = "linearizable"
+	consistencyStale        readConsistency = "stale"
+)
+
+func parseConsistency(r *http.Request) readConsistency {
+	switch r.URL.Query().Get("consistency") {
+	case "linearizable":
+		return consistencyLinearizable
+	default:
+		return consistencyStale
+	}
+}
+
+// confirmLeader performs a trivial read-index check: a linearizable read is
+// only honored locally when this node believes itself to be leader. A
+// follower is told to retry against the leader instead of silently serving
+// possibly-stale data.
+func (rn *raftNode) confirmLeader() error {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	if rn.role != roleLeader {
+		return fmt.Errorf("raft: not leader, current leader is %q", rn.leaderID)
+	}
+	return nil
+}
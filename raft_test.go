@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestRaftNode(t *testing.T, id string) *raftNode {
+	t.Helper()
+	gs := NewGraphStore()
+	rn := newRaftNode(id, t.TempDir(), gs)
+	gs.raft = rn
+	return rn
+}
+
+func TestProposeAppliesLocallyOnLeader(t *testing.T) {
+	rn := newTestRaftNode(t, "node1")
+	if err := rn.Propose(entryAddNode, Node{ID: "alice"}); err != nil {
+		t.Fatalf("Propose: %v", err)
+	}
+	if _, ok := rn.gs.GetNode("alice"); !ok {
+		t.Error("expected node to be applied locally on the leader")
+	}
+}
+
+func TestWALReplayRebuildsState(t *testing.T) {
+	dataDir := t.TempDir()
+	gs := NewGraphStore()
+	rn := newRaftNode("node1", dataDir, gs)
+	gs.raft = rn
+	if err := rn.Propose(entryAddNode, Node{ID: "alice"}); err != nil {
+		t.Fatalf("Propose: %v", err)
+	}
+	rn.wal.Close()
+
+	gs2 := NewGraphStore()
+	rn2 := newRaftNode("node1", dataDir, gs2)
+	gs2.raft = rn2
+	if _, ok := gs2.GetNode("alice"); !ok {
+		t.Error("expected replay to restore the node added before restart")
+	}
+	if rn2.lastIndex != rn.lastIndex {
+		t.Errorf("lastIndex after replay = %d, want %d", rn2.lastIndex, rn.lastIndex)
+	}
+}
+
+func TestJoinDemotesToFollowerAndAdoptsLeader(t *testing.T) {
+	leader := newTestRaftNode(t, "leader")
+	// Mirrors what main() does for the bootstrap node: register itself in its
+	// own membership list before anyone can join, so the join response below
+	// actually includes the leader.
+	leader.members[leader.id] = member{ID: leader.id, ClientURL: "http://leader"}
+	srv := httptest.NewServer(http.HandlerFunc(leader.handleMembers))
+	defer srv.Close()
+
+	follower := newTestRaftNode(t, "follower")
+	self := member{ID: follower.id, PeerURL: "http://follower", ClientURL: "http://follower"}
+	if err := follower.join(srv.URL, self); err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	if err := follower.confirmLeader(); err == nil {
+		t.Error("expected a joined follower to no longer consider itself leader")
+	}
+
+	follower.mu.Lock()
+	leaderID := follower.leaderID
+	_, knowsLeader := follower.members[leader.id]
+	follower.mu.Unlock()
+	if leaderID != leader.id {
+		t.Errorf("leaderID = %q, want %q", leaderID, leader.id)
+	}
+	if !knowsLeader {
+		t.Error("expected follower to learn about the leader from the join response's membership list")
+	}
+}
+
+func TestRequireClusterSecretRejectsMismatch(t *testing.T) {
+	rn := newTestRaftNode(t, "node1")
+	rn.clusterSecret = "s3cr3t"
+	var called bool
+	h := rn.requireClusterSecret(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/members", nil)
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("missing cluster secret: expected 401, got %d", rec.Code)
+	}
+	if called {
+		t.Error("handler ran without the correct cluster secret")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v2/members", nil)
+	req.Header.Set(clusterSecretHeader, "s3cr3t")
+	rec = httptest.NewRecorder()
+	h(rec, req)
+	if !called {
+		t.Error("handler did not run despite the correct cluster secret")
+	}
+}
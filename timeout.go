@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// deadlineTimer is a resettable timer that closes a shared channel once it
+// fires, analogous to the read/write deadline pattern used by net.Conn:
+// any number of goroutines can select on Done() without each owning their
+// own timer, and a call to Reset pushes the deadline out again as long as
+// work is still making progress.
+type deadlineTimer struct {
+	mu    sync.Mutex
+	timer *time.Timer
+	done  chan struct{}
+}
+
+func newDeadlineTimer(d time.Duration) *deadlineTimer {
+	dt := &deadlineTimer{done: make(chan struct{})}
+	dt.timer = time.AfterFunc(d, func() {
+		dt.mu.Lock()
+		defer dt.mu.Unlock()
+		select {
+		case <-dt.done:
+		default:
+			close(dt.done)
+		}
+	})
+	return dt
+}
+
+// Reset pushes the deadline out by d, as long as it hasn't already fired.
+func (dt *deadlineTimer) Reset(d time.Duration) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	select {
+	case <-dt.done:
+		return // already fired; nothing to reset
+	default:
+	}
+	dt.timer.Reset(d)
+}
+
+// Stop releases the underlying timer; call it once the guarded work
+// finishes successfully so the timer doesn't fire needlessly.
+func (dt *deadlineTimer) Stop() {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	dt.timer.Stop()
+}
+
+// Done fires once the deadline elapses without an intervening Reset.
+func (dt *deadlineTimer) Done() <-chan struct{} {
+	return dt.done
+}
+
+// timeoutWriter guards an http.ResponseWriter so the handler goroutine
+// spawned by requestTimeoutMiddleware and the middleware's own timeout path
+// never write to the underlying connection concurrently: every write goes
+// through mu, and once the deadline has fired any write the handler is
+// still in the middle of is silently dropped instead of racing the 504
+// the middleware already sent.
+type timeoutWriter struct {
+	mu          sync.Mutex
+	w           http.ResponseWriter
+	h           http.Header
+	wroteHeader bool
+	timedOut    bool
+}
+
+func newTimeoutWriter(w http.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{w: w, h: make(http.Header)}
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.h }
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.w.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(code)
+}
+
+// timeoutAndWriteError marks tw as timed out, dropping any write the
+// handler goroutine makes from here on, and writes the 504 itself. It is a
+// no-op if the handler already finished (and wrote a header) first.
+func (tw *timeoutWriter) timeoutAndWriteError(msg string) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.wroteHeader {
+		return
+	}
+	tw.timedOut = true
+	http.Error(tw.w, msg, http.StatusGatewayTimeout)
+}
+
+// requestTimeoutMiddleware honors an X-Request-Timeout header (e.g. "5s")
+// by deriving a context.WithTimeout before invoking the handler. Handlers
+// that thread ctx through to the store (Export, query execution, ingest)
+// can then stop partway through and roll back instead of racing the client.
+// If the handler hasn't responded by the deadline, the middleware itself
+// writes 504 Gateway Timeout; the handler goroutine may still be running at
+// that point, so it is given a timeoutWriter rather than the real
+// ResponseWriter to keep the two from writing to the connection at once.
+func requestTimeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := r.Header.Get("X-Request-Timeout")
+		if raw == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid X-Request-Timeout: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		tw := newTimeoutWriter(w)
+		done := make(chan struct{})
+		go func() {
+			next.ServeHTTP(tw, r)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			tw.timeoutAndWriteError("request exceeded X-Request-Timeout")
+		}
+	})
+}
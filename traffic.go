@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TrafficController observes per-request traffic and can wrap raw
+// connections, giving operators a single extension point for metrics and
+// tracing without patching every handler. Register one with
+// GraphStore.SetTrafficController.
+type TrafficController interface {
+	ObserveRequest(ctx context.Context, method, path string, bytesIn, bytesOut int64, dur time.Duration)
+	WrapConn(conn net.Conn) net.Conn
+}
+
+// spanEmitter is implemented by traffic controllers that support nested
+// tracing spans (currently otelSpanController). It's checked for via type
+// assertion so TrafficController itself stays minimal.
+type spanEmitter interface {
+	StartSpan(ctx context.Context, name string) (context.Context, func())
+}
+
+// inFlightTracker is implemented by controllers that report an in-flight
+// request gauge (currently prometheusController).
+type inFlightTracker interface {
+	BeginRequest()
+	EndRequest()
+}
+
+// SetTrafficController installs the controller used by trafficMiddleware.
+// Pass nil to disable traffic observation.
+func (gs *GraphStore) SetTrafficController(tc TrafficController) {
+	gs.traffic = tc
+}
+
+// startSpan begins a child span under the current request's trace, if the
+// installed controller supports tracing. It is a no-op otherwise, so
+// callers (handleAddNode, handleAddEdge, handleQuery) can call it
+// unconditionally.
+func (gs *GraphStore) startSpan(ctx context.Context, name string) (context.Context, func()) {
+	if se, ok := gs.traffic.(spanEmitter); ok {
+		return se.StartSpan(ctx, name)
+	}
+	return ctx, func() {}
+}
+
+// countingResponseWriter tracks how many bytes a handler wrote, so
+// trafficMiddleware can report bytesOut without every handler doing it.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *countingResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *countingResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// wrappingListener applies a TrafficController's WrapConn to every accepted
+// connection, giving a controller a hook into raw connections (byte
+// counters, TLS handshake details, etc.) in addition to the per-request view
+// trafficMiddleware already provides. Install it with listenWithTraffic.
+type wrappingListener struct {
+	net.Listener
+	wrap func(net.Conn) net.Conn
+}
+
+func (l *wrappingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.wrap(conn), nil
+}
+
+// listenWithTraffic opens addr and, if a traffic controller is installed,
+// wraps the listener so every accepted connection passes through its
+// WrapConn before being handed to the server.
+func listenWithTraffic(gs *GraphStore, addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if gs.traffic == nil {
+		return ln, nil
+	}
+	return &wrappingListener{Listener: ln, wrap: gs.traffic.WrapConn}, nil
+}
+
+// trafficMiddleware sits between loggingMiddleware and the mux, timing each
+// request and reporting it to gs.traffic once ServeHTTP returns.
+func trafficMiddleware(gs *GraphStore, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gs.traffic == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ft, ok := gs.traffic.(inFlightTracker); ok {
+			ft.BeginRequest()
+			defer ft.EndRequest()
+		}
+
+		ctx := r.Context()
+		if se, ok := gs.traffic.(spanEmitter); ok {
+			var end func()
+			ctx, end = se.StartSpan(ctx, r.Method+" "+r.URL.Path)
+			defer end()
+		}
+
+		start := time.Now()
+		cw := &countingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(cw, r.WithContext(ctx))
+		dur := time.Since(start)
+
+		gs.traffic.ObserveRequest(ctx, r.Method, r.URL.Path, r.ContentLength, cw.bytes, dur)
+	})
+}
+
+// --- Prometheus exporter ---
+
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// prometheusController is a dependency-free Prometheus text-exposition
+// exporter: request counts by method+path, a latency histogram, node/edge
+// gauges sourced live from the GraphStore, and an in-flight gauge.
+type prometheusController struct {
+	gs *GraphStore
+
+	mu           sync.Mutex
+	requestCount map[string]int64 // "METHOD path" -> count
+	bucketCounts map[string][]int64
+	latencySum   map[string]float64
+	latencyCount map[string]int64
+
+	inFlight int64
+}
+
+func newPrometheusController(gs *GraphStore) *prometheusController {
+	return &prometheusController{
+		gs:           gs,
+		requestCount: make(map[string]int64),
+		bucketCounts: make(map[string][]int64),
+		latencySum:   make(map[string]float64),
+		latencyCount: make(map[string]int64),
+	}
+}
+
+func (pc *prometheusController) ObserveRequest(_ context.Context, method, path string, _, _ int64, dur time.Duration) {
+	key := method + " " + path
+	seconds := dur.Seconds()
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.requestCount[key]++
+	pc.latencySum[key] += seconds
+	pc.latencyCount[key]++
+	buckets, ok := pc.bucketCounts[key]
+	if !ok {
+		buckets = make([]int64, len(latencyBuckets))
+		pc.bucketCounts[key] = buckets
+	}
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			buckets[i]++
+		}
+	}
+}
+
+func (pc *prometheusController) WrapConn(conn net.Conn) net.Conn { return conn }
+
+func (pc *prometheusController) BeginRequest() { atomic.AddInt64(&pc.inFlight, 1) }
+func (pc *prometheusController) EndRequest()   { atomic.AddInt64(&pc.inFlight, -1) }
+
+// handleMetrics renders current state in Prometheus text exposition format.
+func (pc *prometheusController) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	pc.gs.mu.RLock()
+	nodeCount := len(pc.gs.nodes)
+	edgeCount := len(pc.gs.edges)
+	pc.gs.mu.RUnlock()
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP graphstore_node_count Number of nodes currently stored.\n")
+	fmt.Fprintf(&b, "# TYPE graphstore_node_count gauge\n")
+	fmt.Fprintf(&b, "graphstore_node_count %d\n", nodeCount)
+
+	fmt.Fprintf(&b, "# HELP graphstore_edge_count Number of edges currently stored.\n")
+	fmt.Fprintf(&b, "# TYPE graphstore_edge_count gauge\n")
+	fmt.Fprintf(&b, "graphstore_edge_count %d\n", edgeCount)
+
+	fmt.Fprintf(&b, "# HELP graphstore_requests_in_flight Requests currently being handled.\n")
+	fmt.Fprintf(&b, "# TYPE graphstore_requests_in_flight gauge\n")
+	fmt.Fprintf(&b, "graphstore_requests_in_flight %d\n", atomic.LoadInt64(&pc.inFlight))
+
+	fmt.Fprintf(&b, "# HELP graphstore_requests_total Total requests handled, by method and path.\n")
+	fmt.Fprintf(&b, "# TYPE graphstore_requests_total counter\n")
+	for _, key := range sortedKeys(pc.requestCount) {
+		method, path := splitKey(key)
+		fmt.Fprintf(&b, "graphstore_requests_total{method=%q,path=%q} %d\n", method, path, pc.requestCount[key])
+	}
+
+	fmt.Fprintf(&b, "# HELP graphstore_request_duration_seconds Request latency histogram.\n")
+	fmt.Fprintf(&b, "# TYPE graphstore_request_duration_seconds histogram\n")
+	for _, key := range sortedKeys(pc.latencyCount) {
+		method, path := splitKey(key)
+		buckets := pc.bucketCounts[key]
+		for i, le := range latencyBuckets {
+			fmt.Fprintf(&b, "graphstore_request_duration_seconds_bucket{method=%q,path=%q,le=%q} %d\n", method, path, fmt.Sprintf("%g", le), buckets[i])
+		}
+		fmt.Fprintf(&b, "graphstore_request_duration_seconds_bucket{method=%q,path=%q,le=\"+Inf\"} %d\n", method, path, pc.latencyCount[key])
+		fmt.Fprintf(&b, "graphstore_request_duration_seconds_sum{method=%q,path=%q} %g\n", method, path, pc.latencySum[key])
+		fmt.Fprintf(&b, "graphstore_request_duration_seconds_count{method=%q,path=%q} %d\n", method, path, pc.latencyCount[key])
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func splitKey(key string) (method, path string) {
+	parts := strings.SplitN(key, " ", 2)
+	if len(parts) != 2 {
+		return key, ""
+	}
+	return parts[0], parts[1]
+}
+
+// --- OpenTelemetry-style span emitter ---
+
+// span is a minimal stand-in for an OTel span: enough structure to log a
+// request's trace alongside its child operations without depending on the
+// otel SDK.
+type span struct {
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+}
+
+type spanContextKey struct{}
+
+// otelSpanController emits one span per HTTP request plus child spans for
+// store operations (AddNode/AddEdge/query execution), logging each as it
+// ends. A real deployment would ship these to a collector instead.
+type otelSpanController struct{}
+
+func newOTelSpanController() *otelSpanController { return &otelSpanController{} }
+
+func newSpanID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// StartSpan begins a span, nesting it under whatever span is already in ctx
+// (the request root span, for child spans started inside a handler).
+func (o *otelSpanController) StartSpan(ctx context.Context, name string) (context.Context, func()) {
+	parent, _ := ctx.Value(spanContextKey{}).(*span)
+	s := &span{spanID: newSpanID(), name: name, start: time.Now()}
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		s.traceID = newSpanID()
+	}
+	ctx = context.WithValue(ctx, spanContextKey{}, s)
+	return ctx, func() {
+		log.Printf("span trace=%s span=%s parent=%s name=%q dur=%s", s.traceID, s.spanID, s.parentID, s.name, time.Since(s.start))
+	}
+}
+
+func (o *otelSpanController) ObserveRequest(ctx context.Context, method, path string, bytesIn, bytesOut int64, dur time.Duration) {
+	s, _ := ctx.Value(spanContextKey{}).(*span)
+	traceID := ""
+	if s != nil {
+		traceID = s.traceID
+	}
+	log.Printf("request trace=%s method=%s path=%s bytes_in=%d bytes_out=%d dur=%s", traceID, method, path, bytesIn, bytesOut, dur)
+}
+
+func (o *otelSpanController) WrapConn(conn net.Conn) net.Conn { return conn }